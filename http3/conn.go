@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/lucas-clemente/quic-go"
@@ -21,6 +22,67 @@ type connection struct {
 
 	peerStreamsMutex sync.Mutex
 	peerStreams      [4]quic.ReceiveStream
+
+	requestStreamsMutex sync.Mutex
+	requestStreamsCond  *sync.Cond
+	requestStreams      map[quic.StreamID]*requestStream
+
+	uniStreamHandlersMutex sync.Mutex
+	uniStreamHandlers      map[StreamType]func(quic.ReceiveStream)
+
+	qpack *qpackState
+
+	controlStr quic.SendStream
+
+	// highestStreamID is the highest-numbered request stream the server has
+	// accepted, used to compute the ID announced in a graceful GOAWAY.
+	highestStreamMutex sync.Mutex
+	highestStreamID    quic.StreamID
+	highestStreamSeen  bool
+
+	goAwayMutex    sync.Mutex
+	goAwayReceived bool
+	goAwayID       quic.StreamID
+	goAwayCh       chan quic.StreamID
+
+	peerMaxPushIDMutex sync.Mutex
+	peerMaxPushIDSet   bool
+	peerMaxPushID      uint64
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// RegisterUniStreamHandler lets HTTP/3 extensions (e.g. WebTransport) claim a
+// unidirectional stream type that isn't one of the four IETF-reserved types
+// (control, push, QPACK encoder, QPACK decoder). h is called, in a new
+// goroutine, for every incoming stream of this type.
+func (conn *connection) RegisterUniStreamHandler(t StreamType, h func(quic.ReceiveStream)) error {
+	if t < 4 {
+		return fmt.Errorf("http3: cannot register a handler for reserved stream type %s", t)
+	}
+	conn.uniStreamHandlersMutex.Lock()
+	defer conn.uniStreamHandlersMutex.Unlock()
+	if conn.uniStreamHandlers == nil {
+		conn.uniStreamHandlers = make(map[StreamType]func(quic.ReceiveStream))
+	}
+	conn.uniStreamHandlers[t] = h
+	return nil
+}
+
+// OpenUniStream opens a new unidirectional stream prefixed with t's varint
+// encoding, for HTTP/3 extensions (e.g. WebTransport) that need their own
+// stream types. t must not be one of the four IETF-reserved types.
+func (conn *connection) OpenUniStream(t StreamType) (quic.SendStream, error) {
+	if t < 4 {
+		return nil, fmt.Errorf("http3: cannot open a stream of reserved type %s", t)
+	}
+	str, err := conn.session.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	quicvarint.Write(quicvarint.NewWriter(str), uint64(t))
+	return str, nil
 }
 
 var (
@@ -60,17 +122,38 @@ func newConn(s quic.EarlySession, settings Settings) (*connection, error) {
 		session:          s,
 		settings:         settings,
 		peerSettingsDone: make(chan struct{}),
+		requestStreams:   make(map[quic.StreamID]*requestStream),
+		goAwayCh:         make(chan quic.StreamID, 1),
 	}
+	conn.requestStreamsCond = sync.NewCond(&conn.requestStreamsMutex)
 
 	str, err := conn.session.OpenUniStream()
 	if err != nil {
 		return nil, err
 	}
+	conn.controlStr = str
 	w := quicvarint.NewWriter(str)
 	quicvarint.Write(w, uint64(StreamTypeControl))
-	conn.settings.writeFrame(w)
+	if err := conn.settings.WriteFrame(str); err != nil {
+		return nil, err
+	}
+
+	encoderStr, err := conn.session.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	quicvarint.Write(quicvarint.NewWriter(encoderStr), uint64(StreamTypeQPACKEncoder))
+
+	decoderStr, err := conn.session.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	quicvarint.Write(quicvarint.NewWriter(decoderStr), uint64(StreamTypeQPACKDecoder))
+
+	conn.qpack = newQPACKState(encoderStr, decoderStr)
 
 	go conn.handleIncomingUniStreams()
+	go conn.handleDatagrams()
 
 	return conn, nil
 }
@@ -118,12 +201,25 @@ func (conn *connection) handleIncomingUniStream(str quic.ReceiveStream) {
 		// We never increased the Push ID, so we don't expect any push streams.
 		conn.session.CloseWithError(quic.ApplicationErrorCode(errorIDError), "MAX_PUSH_ID = 0")
 		return
-	case StreamTypeQPACKEncoder, StreamTypeQPACKDecoder:
-		// TODO: handle QPACK dynamic tables
+	case StreamTypeQPACKEncoder:
+		go conn.qpack.readEncoderStream(str)
+	case StreamTypeQPACKDecoder:
+		go conn.qpack.readDecoderStream(str)
 	default:
-		// TODO: demultiplex incoming uni streams
+		conn.uniStreamHandlersMutex.Lock()
+		h, ok := conn.uniStreamHandlers[streamType]
+		conn.uniStreamHandlersMutex.Unlock()
+		if ok {
+			go h(str)
+			return
+		}
+		if isGreaseStreamType(streamType) {
+			// RFC 9114 Section 7.2.8: grease stream types must be ignored,
+			// not treated as an error; drain it so the peer isn't blocked.
+			go io.Copy(io.Discard, str)
+			return
+		}
 		str.CancelRead(quic.StreamErrorCode(errorStreamCreationError))
-		// conn.incomingUniStreams <- str
 	}
 }
 
@@ -154,10 +250,162 @@ func (conn *connection) handleControlStream(str quic.ReceiveStream) {
 		conn.peerSettingsErr = err
 		return
 	}
+	if err := settings.validate(); err != nil {
+		err := &quic.ApplicationError{
+			ErrorCode:    quic.ApplicationErrorCode(errorSettingsError),
+			ErrorMessage: err.Error(),
+		}
+		conn.session.CloseWithError(err.ErrorCode, err.ErrorMessage)
+		conn.peerSettingsErr = err
+		return
+	}
 	conn.peerSettings = settings
+	if err := settings.applyToConn(conn); err != nil {
+		err := &quic.ApplicationError{
+			ErrorCode:    quic.ApplicationErrorCode(errorSettingsError),
+			ErrorMessage: err.Error(),
+		}
+		conn.session.CloseWithError(err.ErrorCode, err.ErrorMessage)
+		conn.peerSettingsErr = err
+		return
+	}
 	close(conn.peerSettingsDone)
 
-	// TODO: loop reading the reset of the frames from the control stream
+	for {
+		f, err := parseNextFrame(str)
+		if err != nil {
+			code := errorClosedCriticalStream
+			if _, ok := err.(*frameTypeError); ok {
+				code = errorFrameUnexpected
+			}
+			conn.session.CloseWithError(quic.ApplicationErrorCode(code), "")
+			return
+		}
+		var handleErr error
+		switch v := f.(type) {
+		case Settings:
+			handleErr = &connError{Code: errorFrameUnexpected, Err: errors.New("second SETTINGS frame")}
+		case *goAwayFrame:
+			handleErr = conn.handleGoAway(v.StreamID)
+		case *maxPushIDFrame:
+			handleErr = conn.handleMaxPushID(v.ID)
+		}
+		if handleErr != nil {
+			var ce *connError
+			if errors.As(handleErr, &ce) {
+				conn.session.CloseWithError(quic.ApplicationErrorCode(ce.Code), ce.Err.Error())
+			} else {
+				conn.session.CloseWithError(quic.ApplicationErrorCode(errorInternalError), "")
+			}
+			return
+		}
+	}
+}
+
+// handleGoAway records a GOAWAY frame received from the peer. The peer may
+// send more than one, each lowering the ID further; an increasing ID is a
+// connection error, RFC 9114 Section 5.2.
+func (conn *connection) handleGoAway(id quic.StreamID) error {
+	conn.goAwayMutex.Lock()
+	defer conn.goAwayMutex.Unlock()
+	if conn.goAwayReceived && id > conn.goAwayID {
+		return &connError{Code: errorIDError, Err: errors.New("GOAWAY ID increased")}
+	}
+	conn.goAwayReceived = true
+	conn.goAwayID = id
+	select {
+	case <-conn.goAwayCh:
+	default:
+	}
+	conn.goAwayCh <- id
+	return nil
+}
+
+// handleMaxPushID records the peer's MAX_PUSH_ID, RFC 9114 Section 7.2.7.
+// The client is the only side that sends this frame; a decreasing value is
+// a connection error.
+func (conn *connection) handleMaxPushID(id uint64) error {
+	conn.peerMaxPushIDMutex.Lock()
+	defer conn.peerMaxPushIDMutex.Unlock()
+	if conn.peerMaxPushIDSet && id < conn.peerMaxPushID {
+		return &connError{Code: errorIDError, Err: errors.New("MAX_PUSH_ID decreased")}
+	}
+	conn.peerMaxPushIDSet = true
+	conn.peerMaxPushID = id
+	return nil
+}
+
+// ReceivedGoAway returns a channel that receives the stream ID carried by
+// each GOAWAY frame the peer sends, RFC 9114 Section 5.2. The channel holds
+// only the most recent ID: one that hasn't been read yet is replaced by the
+// next. OpenRequestStream refuses to open streams at or above the most
+// recently received value.
+func (conn *connection) ReceivedGoAway() <-chan quic.StreamID {
+	return conn.goAwayCh
+}
+
+// Shutdown gracefully closes the connection: it sends a GOAWAY announcing
+// the lowest stream (server) or push (client) ID it will no longer accept,
+// waits for in-flight request streams to finish, and then closes the session
+// with H3_NO_ERROR. If ctx is done first, it returns ctx's error and leaves
+// the session open.
+func (conn *connection) Shutdown(ctx context.Context) error {
+	conn.shutdownOnce.Do(func() {
+		var id quic.StreamID
+		if conn.session.Perspective() == quic.PerspectiveServer {
+			conn.highestStreamMutex.Lock()
+			if conn.highestStreamSeen {
+				id = conn.highestStreamID + 4
+			}
+			conn.highestStreamMutex.Unlock()
+		}
+		// As a client, we never increase the Push ID, so we always announce 0.
+		if conn.shutdownErr = (&goAwayFrame{StreamID: id}).writeFrame(conn.controlStr); conn.shutdownErr != nil {
+			return
+		}
+		if conn.shutdownErr = conn.waitForRequestStreamsDone(ctx); conn.shutdownErr != nil {
+			return
+		}
+		conn.session.CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+	})
+	return conn.shutdownErr
+}
+
+// waitForRequestStreamsDone blocks until every request stream has been
+// closed, or until ctx is done.
+func (conn *connection) waitForRequestStreamsDone(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Broadcast under the lock so it can't slip in between the
+			// waiter's ctx.Err() check and its Wait.
+			conn.requestStreamsMutex.Lock()
+			conn.requestStreamsCond.Broadcast()
+			conn.requestStreamsMutex.Unlock()
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	conn.requestStreamsMutex.Lock()
+	defer conn.requestStreamsMutex.Unlock()
+	for len(conn.requestStreams) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		conn.requestStreamsCond.Wait()
+	}
+	return nil
+}
+
+// deregisterRequestStream removes a finished request stream from the set
+// Shutdown waits on.
+func (conn *connection) deregisterRequestStream(id quic.StreamID) {
+	conn.requestStreamsMutex.Lock()
+	delete(conn.requestStreams, id)
+	conn.requestStreamsMutex.Unlock()
+	conn.requestStreamsCond.Broadcast()
 }
 
 // TODO: demultiplex incoming bidi streams
@@ -169,6 +417,12 @@ func (conn *connection) AcceptRequestStream(ctx context.Context) (RequestStream,
 	if err != nil {
 		return nil, err
 	}
+	conn.highestStreamMutex.Lock()
+	if !conn.highestStreamSeen || str.StreamID() > conn.highestStreamID {
+		conn.highestStreamID = str.StreamID()
+		conn.highestStreamSeen = true
+	}
+	conn.highestStreamMutex.Unlock()
 	return newRequestStream(conn, str)
 }
 
@@ -181,6 +435,14 @@ func (conn *connection) OpenRequestStream(ctx context.Context) (RequestStream, e
 	if err != nil {
 		return nil, err
 	}
+	conn.goAwayMutex.Lock()
+	rejected := conn.goAwayReceived && str.StreamID() >= conn.goAwayID
+	conn.goAwayMutex.Unlock()
+	if rejected {
+		str.CancelWrite(quic.StreamErrorCode(errorRequestRejected))
+		str.CancelRead(quic.StreamErrorCode(errorRequestRejected))
+		return nil, &streamError{Code: errorRequestRejected, Err: errors.New("stream rejected: GOAWAY received")}
+	}
 	return newRequestStream(conn, str)
 }
 
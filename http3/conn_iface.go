@@ -0,0 +1,44 @@
+package http3
+
+import (
+	"context"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// Conn is an HTTP/3 connection running on top of a QUIC connection.
+type Conn interface {
+	// Settings returns the settings this side of the connection sent.
+	Settings() Settings
+	// PeerSettings blocks until the peer's SETTINGS frame has been read.
+	PeerSettings() (Settings, error)
+	// RegisterUniStreamHandler lets HTTP/3 extensions (e.g. WebTransport)
+	// claim a unidirectional stream type that isn't one of the four
+	// IETF-reserved types (control, push, QPACK encoder, QPACK decoder).
+	RegisterUniStreamHandler(t StreamType, h func(quic.ReceiveStream)) error
+	// OpenUniStream opens a new unidirectional stream prefixed with t's
+	// varint encoding, for HTTP/3 extensions that need their own stream
+	// types. t must not be one of the four IETF-reserved types.
+	OpenUniStream(t StreamType) (quic.SendStream, error)
+	// ReceivedGoAway returns a channel that receives the stream ID carried
+	// by each GOAWAY frame the peer sends, RFC 9114 Section 5.2. Only the
+	// most recent ID is held; an unread one is replaced by the next.
+	ReceivedGoAway() <-chan quic.StreamID
+	// Shutdown gracefully closes the connection: it sends a GOAWAY, waits
+	// for in-flight request streams to finish, and then closes the session
+	// with H3_NO_ERROR. If ctx is done first, it returns ctx's error and
+	// leaves the session open.
+	Shutdown(ctx context.Context) error
+}
+
+// ServerConn is an HTTP/3 connection, as seen by a server.
+type ServerConn interface {
+	Conn
+	AcceptRequestStream(ctx context.Context) (RequestStream, error)
+}
+
+// ClientConn is an HTTP/3 connection, as seen by a client.
+type ClientConn interface {
+	Conn
+	OpenRequestStream(ctx context.Context) (RequestStream, error)
+}
@@ -0,0 +1,106 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// datagramQueueLen is the number of HTTP/3 datagrams buffered per request
+// stream before newly received datagrams are dropped.
+const datagramQueueLen = 32
+
+// usesDatagramDraft00 says whether peerSettings only advertised the older
+// draft-ietf-masque-h3-datagram-00 context-ID encoding.
+func usesDatagramDraft00(peerSettings Settings) bool {
+	return peerSettings[SettingDatagram] == 0 && peerSettings[SettingDatagramDraft00] > 0
+}
+
+// SendDatagram sends an HTTP/3 datagram associated with this request stream,
+// as defined in draft-ietf-masque-h3-datagram. The quarter stream ID
+// (StreamID / 4) is prepended to b as a QUIC varint; if the peer only
+// advertised the draft-00 setting, the full stream ID is prepended instead.
+func (str *requestStream) SendDatagram(b []byte) error {
+	peerSettings, err := str.conn.PeerSettings()
+	if err != nil {
+		return err
+	}
+	if !str.conn.settings.DatagramsEnabled() || !peerSettings.DatagramsEnabled() {
+		return &connError{Code: errorSettingsError, Err: errors.New("H3_DATAGRAM not negotiated")}
+	}
+	buf := &bytes.Buffer{}
+	qw := quicvarint.NewWriter(buf)
+	if usesDatagramDraft00(peerSettings) {
+		quicvarint.Write(qw, uint64(str.StreamID()))
+	} else {
+		quicvarint.Write(qw, uint64(str.StreamID())/4)
+	}
+	buf.Write(b)
+	return str.conn.session.SendMessage(buf.Bytes())
+}
+
+// ReceiveDatagram blocks until an HTTP/3 datagram addressed to this request
+// stream is received, or until ctx is done.
+func (str *requestStream) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-str.datagrams:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-str.conn.session.Context().Done():
+		return nil, str.conn.session.Context().Err()
+	}
+}
+
+// handleDatagrams waits for the peer's SETTINGS frame and, if both sides
+// negotiated H3_DATAGRAM, demultiplexes incoming QUIC DATAGRAM frames onto
+// the request stream they're addressed to. A peer that sends a datagram
+// without having negotiated H3_DATAGRAM is treated as a protocol violation.
+func (conn *connection) handleDatagrams() {
+	select {
+	case <-conn.peerSettingsDone:
+	case <-conn.session.Context().Done():
+		return
+	}
+	negotiated := conn.peerSettingsErr == nil && conn.settings.DatagramsEnabled() && conn.peerSettings.DatagramsEnabled()
+	draft00 := negotiated && usesDatagramDraft00(conn.peerSettings)
+
+	for {
+		data, err := conn.session.ReceiveMessage()
+		if err != nil {
+			return
+		}
+		if !negotiated {
+			conn.session.CloseWithError(quic.ApplicationErrorCode(errorSettingsError), "received H3 datagram without negotiating H3_DATAGRAM")
+			return
+		}
+
+		r := bytes.NewReader(data)
+		ctxID, err := quicvarint.Read(r)
+		if err != nil {
+			continue
+		}
+		var id quic.StreamID
+		if draft00 {
+			id = quic.StreamID(ctxID)
+		} else {
+			id = quic.StreamID(ctxID * 4)
+		}
+		payload := data[len(data)-r.Len():]
+
+		conn.requestStreamsMutex.Lock()
+		str, ok := conn.requestStreams[id]
+		conn.requestStreamsMutex.Unlock()
+		if !ok {
+			continue
+		}
+		select {
+		case str.datagrams <- payload:
+		default:
+			// the receiver isn't keeping up; drop the datagram
+		}
+	}
+}
@@ -31,6 +31,13 @@ const (
 	errorWebTransportBufferedStreamRejected errorCode = 0x3994bd84
 )
 
+// ErrCodeWebTransportBufferedStreamRejected is the application error code
+// used to reject a WebTransport stream that arrived before its session's
+// CONNECT request was registered and the buffering threshold was hit.
+// It's exported so extension packages (e.g. webtransport) that are built on
+// top of this one can use it directly.
+const ErrCodeWebTransportBufferedStreamRejected = quic.ApplicationErrorCode(errorWebTransportBufferedStreamRejected)
+
 func (e errorCode) String() string {
 	switch e {
 	case errorNoError:
@@ -0,0 +1,56 @@
+package http3
+
+import "fmt"
+
+// FrameType is the type of an HTTP/3 frame, RFC 9114 Section 7.2.
+type FrameType uint64
+
+func (t FrameType) String() string {
+	switch t {
+	case FrameTypeData:
+		return "DATA"
+	case FrameTypeHeaders:
+		return "HEADERS"
+	case FrameTypeSettings:
+		return "SETTINGS"
+	case FrameTypeGoAway:
+		return "GOAWAY"
+	case FrameTypeMaxPushID:
+		return "MAX_PUSH_ID"
+	default:
+		return fmt.Sprintf("unknown frame type %#x", uint64(t))
+	}
+}
+
+// StreamType is the type of a unidirectional QUIC stream, RFC 9114 Section 6.2.
+type StreamType uint64
+
+const (
+	StreamTypeControl StreamType = iota
+	StreamTypePush
+	StreamTypeQPACKEncoder
+	StreamTypeQPACKDecoder
+)
+
+func (t StreamType) String() string {
+	switch t {
+	case StreamTypeControl:
+		return "control stream"
+	case StreamTypePush:
+		return "push stream"
+	case StreamTypeQPACKEncoder:
+		return "QPACK encoder stream"
+	case StreamTypeQPACKDecoder:
+		return "QPACK decoder stream"
+	default:
+		return fmt.Sprintf("unknown stream type %#x", uint64(t))
+	}
+}
+
+// isGreaseStreamType reports whether t is one of the reserved stream types
+// of the form 0x1f*N+0x21 that RFC 9114 Section 7.2.8 uses to exercise
+// unknown-stream-type handling. Receivers must ignore these rather than
+// treat them as an error.
+func isGreaseStreamType(t StreamType) bool {
+	return t >= 0x21 && (t-0x21)%0x1f == 0
+}
@@ -0,0 +1,94 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// maxControlFrameLen bounds the size of a GOAWAY or MAX_PUSH_ID frame this
+// package will parse; both only ever carry a single varint.
+const maxControlFrameLen = 16
+
+// goAwayFrame is a GOAWAY frame, RFC 9114 Section 7.2.6.
+type goAwayFrame struct {
+	StreamID quic.StreamID
+}
+
+func (f *goAwayFrame) writeFrame(w io.Writer) error {
+	qw := quicvarint.NewWriter(w)
+	quicvarint.Write(qw, FrameTypeGoAway)
+	quicvarint.Write(qw, uint64(quicvarint.Len(uint64(f.StreamID))))
+	quicvarint.Write(qw, uint64(f.StreamID))
+	return nil
+}
+
+// maxPushIDFrame is a MAX_PUSH_ID frame, RFC 9114 Section 7.2.7.
+type maxPushIDFrame struct {
+	ID uint64
+}
+
+// parseNextFrame reads the next control-stream frame from r. Frame types
+// this package doesn't recognize are skipped, per RFC 9114 Section 9, which
+// requires unknown frame types to be ignored. DATA and HEADERS, which are
+// invalid on the control stream, are reported as a *frameTypeError.
+func parseNextFrame(r io.Reader) (interface{}, error) {
+	for {
+		qr := quicvarint.NewReader(r)
+		t, err := quicvarint.Read(qr)
+		if err != nil {
+			return nil, err
+		}
+		l, err := quicvarint.Read(qr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch FrameType(t) {
+		case FrameTypeData, FrameTypeHeaders:
+			io.CopyN(io.Discard, r, int64(l))
+			return nil, &frameTypeError{Want: FrameTypeSettings, Type: FrameType(t)}
+		case FrameTypeSettings:
+			b := make([]byte, l)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, err
+			}
+			s := Settings{}
+			if err := s.UnmarshalFrame(b); err != nil {
+				return nil, err
+			}
+			return s, nil
+		case FrameTypeGoAway:
+			id, err := readControlFrameVarint(r, FrameTypeGoAway, l)
+			if err != nil {
+				return nil, err
+			}
+			return &goAwayFrame{StreamID: quic.StreamID(id)}, nil
+		case FrameTypeMaxPushID:
+			id, err := readControlFrameVarint(r, FrameTypeMaxPushID, l)
+			if err != nil {
+				return nil, err
+			}
+			return &maxPushIDFrame{ID: id}, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(l)); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readControlFrameVarint reads a frame payload of length l and decodes it as
+// a single varint, as used by both GOAWAY and MAX_PUSH_ID.
+func readControlFrameVarint(r io.Reader, t FrameType, l uint64) (uint64, error) {
+	if l > maxControlFrameLen {
+		return 0, &frameLengthError{FrameType: t, Length: l, Max: maxControlFrameLen}
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	return quicvarint.Read(quicvarint.NewReader(bytes.NewReader(b)))
+}
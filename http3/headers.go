@@ -0,0 +1,41 @@
+package http3
+
+import (
+	"io"
+
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// FrameTypeHeaders is the frame type of a HEADERS frame, RFC 9114 Section 7.2.2.
+const FrameTypeHeaders = 0x1
+
+func writeHeadersFrame(w io.Writer, encoded []byte) error {
+	qw := quicvarint.NewWriter(w)
+	quicvarint.Write(qw, FrameTypeHeaders)
+	quicvarint.Write(qw, uint64(len(encoded)))
+	_, err := w.Write(encoded)
+	return err
+}
+
+func readHeadersFrame(r io.Reader, maxLen uint64) ([]byte, error) {
+	qr := quicvarint.NewReader(r)
+	t, err := quicvarint.Read(qr)
+	if err != nil {
+		return nil, err
+	}
+	if t != FrameTypeHeaders {
+		return nil, &frameTypeError{Want: FrameTypeHeaders, Type: FrameType(t)}
+	}
+	l, err := quicvarint.Read(qr)
+	if err != nil {
+		return nil, err
+	}
+	if l > maxLen {
+		return nil, &frameLengthError{FrameType: FrameType(t), Length: l, Max: maxLen}
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
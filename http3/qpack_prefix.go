@@ -0,0 +1,27 @@
+package http3
+
+import "io"
+
+// readPrefixedInt reads a variable-length integer using the prefixed-integer
+// encoding shared by QPACK and HPACK (RFC 9204 Section 4.1.1 / RFC 7541
+// Section 5.1). first is the byte that already carries the low n-bit prefix.
+func readPrefixedInt(first byte, n uint8, r io.ByteReader) (uint64, error) {
+	prefixMax := uint64(1)<<n - 1
+	val := uint64(first) & prefixMax
+	if val < prefixMax {
+		return val, nil
+	}
+	var shift uint
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		val += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+	return val, nil
+}
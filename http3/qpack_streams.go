@@ -0,0 +1,102 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/marten-seemann/qpack"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+var errQPACKDecompressionFailed = errors.New("qpack: decompression failed")
+
+// qpackState holds the per-connection QPACK encoder and decoder streams.
+//
+// The vendored github.com/marten-seemann/qpack library only implements the
+// QPACK static table (RFC 9204 Section 3.2.2); it has no dynamic table. This
+// side therefore never inserts an entry into one, and by default doesn't
+// advertise QPACK_MAX_TABLE_CAPACITY, which leaves it at 0 and tells the
+// peer's encoder it must never reference a dynamic table entry when
+// compressing fields for us either. Every field section we send has a
+// Required Insert Count of 0, and a received one with a nonzero Required
+// Insert Count is rejected, even if a nonzero capacity was set with
+// Settings.SetQPACKMaxTableCapacity. The encoder and decoder streams RFC 9114
+// Section 4.2 requires are still opened, but never carry instructions.
+type qpackState struct {
+	encoderStr quic.SendStream
+	decoderStr quic.SendStream
+}
+
+func newQPACKState(encoderStr, decoderStr quic.SendStream) *qpackState {
+	return &qpackState{encoderStr: encoderStr, decoderStr: decoderStr}
+}
+
+// readEncoderStream drains the peer's QPACK encoder stream. A compliant
+// peer, honoring our advertised QPACK_MAX_TABLE_CAPACITY of 0, never sends
+// dynamic-table instructions on it; anything that does arrive is discarded
+// rather than parsed, since we have no dynamic table to apply it to.
+func (q *qpackState) readEncoderStream(str quic.ReceiveStream) {
+	io.Copy(io.Discard, str)
+}
+
+// readDecoderStream drains the peer's QPACK decoder stream. We never
+// reference the dynamic table when encoding, so the peer has nothing to
+// acknowledge, cancel, or be told about an insert count increment for.
+func (q *qpackState) readDecoderStream(str quic.ReceiveStream) {
+	io.Copy(io.Discard, str)
+}
+
+// writeFieldSection QPACK-encodes headers, including any pseudo-headers,
+// entirely against the static table: the vendored qpack library has no
+// dynamic table to reference.
+func (q *qpackState) writeFieldSection(headers []qpack.HeaderField) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := qpack.NewEncoder(&buf)
+	for _, f := range headers {
+		if err := enc.WriteField(f); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// readFieldSection decodes a complete, already-framed header block. A
+// nonzero Required Insert Count means the peer referenced a dynamic table
+// entry — we have no dynamic table to resolve that against, so it's a
+// decompression failure whatever QPACK_MAX_TABLE_CAPACITY was advertised.
+func (q *qpackState) readFieldSection(b []byte) ([]qpack.HeaderField, error) {
+	if len(b) == 0 {
+		return nil, errQPACKDecompressionFailed
+	}
+	r := newByteSliceReader(b)
+	first, _ := r.ReadByte()
+	encodedCount, err := readPrefixedInt(first, 8, r)
+	if err != nil {
+		return nil, err
+	}
+	if encodedCount > 0 {
+		return nil, errQPACKDecompressionFailed
+	}
+	return qpack.NewDecoder(nil).DecodeFull(b)
+}
+
+// byteSliceReader is a minimal io.ByteReader over a byte slice, used to read
+// the QPACK field-section prefix without pulling in bufio for an
+// already-fully-buffered header block.
+type byteSliceReader struct {
+	b   []byte
+	pos int
+}
+
+func newByteSliceReader(b []byte) *byteSliceReader { return &byteSliceReader{b: b} }
+
+func (r *byteSliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, errQPACKDecompressionFailed
+	}
+	c := r.b[r.pos]
+	r.pos++
+	return c, nil
+}
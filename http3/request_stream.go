@@ -0,0 +1,165 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/marten-seemann/qpack"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// maxHeaderBytes bounds the size of a single HEADERS frame this package will
+// decode.
+const maxHeaderBytes = 64 * 1024
+
+// RequestStream is the bidirectional stream used to carry a single HTTP/3
+// request-response exchange.
+type RequestStream interface {
+	quic.Stream
+
+	// SendHeaders writes headers, including any pseudo-headers, as a
+	// HEADERS frame.
+	SendHeaders(headers []qpack.HeaderField) error
+	// ReadHeaders reads and decodes the next HEADERS frame.
+	ReadHeaders() ([]qpack.HeaderField, error)
+
+	// SendDatagram sends an HTTP/3 datagram associated with this request
+	// stream, as defined in draft-ietf-masque-h3-datagram.
+	SendDatagram(b []byte) error
+	// ReceiveDatagram blocks until an HTTP/3 datagram addressed to this
+	// request stream is received, or until ctx is done.
+	ReceiveDatagram(ctx context.Context) ([]byte, error)
+
+	// Upgrade returns the stream as a bidirectional byte stream, once a 2xx
+	// response to a (possibly extended, RFC 9220) CONNECT request has been
+	// sent via SendHeaders. It's the hook WebTransport and CONNECT-UDP
+	// (MASQUE) build their stream tunnelling on top of, and lets users
+	// implement their own upgrade protocols the same way.
+	Upgrade() (io.ReadWriteCloser, error)
+}
+
+type requestStream struct {
+	quic.Stream
+
+	conn *connection
+
+	datagrams chan []byte
+
+	// stateMu guards sentStatus and sawConnect, the Upgrade bookkeeping
+	// updated by SendHeaders and ReadHeaders respectively.
+	stateMu sync.Mutex
+	// sentStatus is the :status pseudo-header value from the most recent
+	// SendHeaders call, if any.
+	sentStatus string
+	// sawConnect records whether the most recent ReadHeaders call read a
+	// (possibly extended) CONNECT request.
+	sawConnect bool
+}
+
+// isConnect reports whether headers carry a :method of CONNECT, either
+// ordinary CONNECT (RFC 9114 Section 4.4) or extended CONNECT (RFC 9220).
+func isConnect(headers []qpack.HeaderField) bool {
+	for _, h := range headers {
+		if h.Name == ":method" {
+			return h.Value == "CONNECT"
+		}
+	}
+	return false
+}
+
+// isExtendedConnect reports whether headers form an RFC 9220 extended CONNECT
+// request: a :method of CONNECT together with a :protocol pseudo-header.
+func isExtendedConnect(headers []qpack.HeaderField) bool {
+	if !isConnect(headers) {
+		return false
+	}
+	for _, h := range headers {
+		if h.Name == ":protocol" {
+			return true
+		}
+	}
+	return false
+}
+
+var _ RequestStream = &requestStream{}
+
+func newRequestStream(conn *connection, str quic.Stream) (*requestStream, error) {
+	rs := &requestStream{
+		Stream:    str,
+		conn:      conn,
+		datagrams: make(chan []byte, datagramQueueLen),
+	}
+	conn.requestStreamsMutex.Lock()
+	conn.requestStreams[str.StreamID()] = rs
+	conn.requestStreamsMutex.Unlock()
+	return rs, nil
+}
+
+func (str *requestStream) SendHeaders(headers []qpack.HeaderField) error {
+	if str.conn.session.Perspective() == quic.PerspectiveClient && isExtendedConnect(headers) {
+		peerSettings, err := str.conn.PeerSettings()
+		if err != nil {
+			return err
+		}
+		if !peerSettings.ExtendedConnectEnabled() {
+			return &streamError{Code: errorConnectError, Err: errors.New("peer didn't enable extended CONNECT")}
+		}
+	}
+	b, err := str.conn.qpack.writeFieldSection(headers)
+	if err != nil {
+		return err
+	}
+	if err := writeHeadersFrame(str, b); err != nil {
+		return err
+	}
+	for _, h := range headers {
+		if h.Name == ":status" {
+			str.stateMu.Lock()
+			str.sentStatus = h.Value
+			str.stateMu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (str *requestStream) ReadHeaders() ([]qpack.HeaderField, error) {
+	b, err := readHeadersFrame(str, maxHeaderBytes)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := str.conn.qpack.readFieldSection(b)
+	if err != nil {
+		return nil, err
+	}
+	str.stateMu.Lock()
+	str.sawConnect = isConnect(fields)
+	str.stateMu.Unlock()
+	return fields, nil
+}
+
+// Close closes the stream's write side and removes it from the connection's
+// set of in-flight request streams, which Conn.Shutdown waits to drain.
+func (str *requestStream) Close() error {
+	err := str.Stream.Close()
+	str.conn.deregisterRequestStream(str.StreamID())
+	return err
+}
+
+func (str *requestStream) Upgrade() (io.ReadWriteCloser, error) {
+	if str.conn.session.Perspective() != quic.PerspectiveServer {
+		return nil, errors.New("http3: Upgrade called on a client request stream")
+	}
+	str.stateMu.Lock()
+	status, sawConnect := str.sentStatus, str.sawConnect
+	str.stateMu.Unlock()
+	if !sawConnect {
+		return nil, errors.New("http3: Upgrade called on a stream that wasn't a CONNECT request")
+	}
+	if len(status) != 3 || status[0] != '2' {
+		return nil, errors.New("http3: Upgrade called before a 2xx response was sent")
+	}
+	return str, nil
+}
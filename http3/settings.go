@@ -5,34 +5,199 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"sync"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/quicvarint"
 )
 
 const (
+	FrameTypeData     = 0x0
 	FrameTypeSettings = 0x4
 
+	// https://www.rfc-editor.org/rfc/rfc9114.html#section-7.2.6
+	FrameTypeGoAway = 0x7
+	// https://www.rfc-editor.org/rfc/rfc9114.html#section-7.2.7
+	FrameTypeMaxPushID = 0xd
+
 	// https://www.ietf.org/archive/id/draft-ietf-masque-h3-datagram-02.html#name-http-settings-parameter
 	SettingDatagram = 0xffd276
 
 	// https://datatracker.ietf.org/doc/draft-ietf-masque-h3-datagram/00/
 	SettingDatagramDraft00 = 0x276
+
+	// https://www.rfc-editor.org/rfc/rfc9204.html#section-5
+	SettingQPACKMaxTableCapacity = 0x1
+	SettingQPACKBlockedStreams   = 0x7
+
+	// https://www.rfc-editor.org/rfc/rfc9220.html#section-3
+	SettingEnableConnectProtocol = 0x8
+
+	// https://www.ietf.org/archive/id/draft-ietf-webtrans-http3-01.html#section-3.2
+	SettingEnableWebTransport = 0x2b603742
 )
 
+// reservedSettingIDs are the HTTP/2-equivalent SETTINGS identifiers RFC 9114
+// Section 7.2.4.1 requires be treated as a connection error if present,
+// since HTTP/3 either doesn't need them or replaced them with a frame.
+var reservedSettingIDs = map[Setting]struct{}{
+	0x2: {},
+	0x3: {},
+	0x4: {},
+	0x5: {},
+}
+
 type Setting uint64
 
 func (s Setting) String() string {
-	switch s {
-	case SettingDatagram:
-		return "H3_DATAGRAM"
-	default:
-		return fmt.Sprintf("H3 SETTING 0x%x", s)
+	settingRegistryMutex.Lock()
+	def, ok := settingRegistry[s]
+	settingRegistryMutex.Unlock()
+	if ok {
+		return def.name
+	}
+	return fmt.Sprintf("H3 SETTING 0x%x", uint64(s))
+}
+
+// settingDef is a registered HTTP/3 SETTINGS parameter, as declared through
+// RegisterSetting.
+type settingDef struct {
+	name        string
+	validate    func(uint64) error
+	applyToConn func(*connection, uint64) error
+}
+
+var (
+	settingRegistryMutex sync.Mutex
+	settingRegistry      = map[Setting]*settingDef{}
+)
+
+// RegisterSetting declares an HTTP/3 SETTINGS parameter: name is used by
+// Setting.String(); validate, if non-nil, is run against a peer's advertised
+// value before it's accepted; applyToConn, if non-nil, is run afterwards to
+// let the setting take effect on the connection. This lets extensions
+// (H3_DATAGRAM, SETTINGS_ENABLE_CONNECT_PROTOCOL, SETTINGS_ENABLE_WEBTRANSPORT,
+// the QPACK capacities, ...) declare themselves once instead of being
+// special-cased in handleControlStream.
+func RegisterSetting(id Setting, name string, validate func(uint64) error, applyToConn func(*connection, uint64) error) {
+	settingRegistryMutex.Lock()
+	defer settingRegistryMutex.Unlock()
+	settingRegistry[id] = &settingDef{name: name, validate: validate, applyToConn: applyToConn}
+}
+
+func validateBoolSetting(v uint64) error {
+	if v > 1 {
+		return fmt.Errorf("must be 0 or 1, got %d", v)
+	}
+	return nil
+}
+
+func init() {
+	RegisterSetting(SettingDatagram, "H3_DATAGRAM", validateBoolSetting, nil)
+	RegisterSetting(SettingDatagramDraft00, "H3_DATAGRAM (draft-00)", validateBoolSetting, nil)
+	// QPACK_MAX_TABLE_CAPACITY has no applyToConn hook: the vendored QPACK
+	// library has no dynamic table, so this side never honors a nonzero
+	// capacity, even one set with SetQPACKMaxTableCapacity. See qpackState in
+	// qpack_streams.go.
+	RegisterSetting(SettingQPACKMaxTableCapacity, "QPACK_MAX_TABLE_CAPACITY", nil, nil)
+	RegisterSetting(SettingQPACKBlockedStreams, "QPACK_BLOCKED_STREAMS", nil, nil)
+	RegisterSetting(SettingEnableConnectProtocol, "SETTINGS_ENABLE_CONNECT_PROTOCOL", validateBoolSetting, nil)
+	RegisterSetting(SettingEnableWebTransport, "SETTINGS_ENABLE_WEBTRANSPORT", validateBoolSetting, nil)
+}
+
+// validate checks s against the reserved HTTP/2 setting IDs and any
+// validator registered for each present ID, RFC 9114 Section 7.2.4.1.
+func (s Settings) validate() error {
+	for id := range s {
+		if _, reserved := reservedSettingIDs[id]; reserved {
+			return fmt.Errorf("reserved setting id %s", id)
+		}
+	}
+	settingRegistryMutex.Lock()
+	defer settingRegistryMutex.Unlock()
+	for id, val := range s {
+		def, ok := settingRegistry[id]
+		if !ok || def.validate == nil {
+			continue
+		}
+		if err := def.validate(val); err != nil {
+			return fmt.Errorf("%s: %w", def.name, err)
+		}
 	}
+	return nil
+}
+
+// applyToConn runs the applyToConn hook registered for each setting present
+// in s against conn, stopping at the first error.
+func (s Settings) applyToConn(conn *connection) error {
+	settingRegistryMutex.Lock()
+	defer settingRegistryMutex.Unlock()
+	for id, val := range s {
+		def, ok := settingRegistry[id]
+		if !ok || def.applyToConn == nil {
+			continue
+		}
+		if err := def.applyToConn(conn, val); err != nil {
+			return fmt.Errorf("%s: %w", def.name, err)
+		}
+	}
+	return nil
 }
 
 type Settings map[Setting]uint64
 
+// EnableDatagrams enables HTTP/3 datagram support, as defined in
+// draft-ietf-masque-h3-datagram.
+func (s Settings) EnableDatagrams() {
+	s[SettingDatagram] = 1
+}
+
+// DatagramsEnabled says whether HTTP/3 datagram support was enabled, via
+// either the current or the draft-00 setting ID.
+func (s Settings) DatagramsEnabled() bool {
+	return s[SettingDatagram] == 1 || s[SettingDatagramDraft00] == 1
+}
+
+// SetQPACKMaxTableCapacity sets the QPACK_MAX_TABLE_CAPACITY value, in
+// bytes, that this side advertises. This package's decoder has no dynamic
+// table: a received field section that references one is rejected whatever
+// value is set here.
+func (s Settings) SetQPACKMaxTableCapacity(capacity uint64) {
+	s[SettingQPACKMaxTableCapacity] = capacity
+}
+
+// QPACKMaxTableCapacity returns the advertised maximum QPACK dynamic table
+// capacity, or 0 if none was set.
+func (s Settings) QPACKMaxTableCapacity() uint64 {
+	return s[SettingQPACKMaxTableCapacity]
+}
+
+// EnableExtendedConnect advertises SETTINGS_ENABLE_CONNECT_PROTOCOL, RFC 9220,
+// letting a CONNECT request carry a :protocol pseudo-header to upgrade the
+// request stream to a different protocol (e.g. WebTransport, CONNECT-UDP).
+func (s Settings) EnableExtendedConnect() {
+	s[SettingEnableConnectProtocol] = 1
+}
+
+// ExtendedConnectEnabled says whether extended CONNECT support, RFC 9220, was
+// enabled.
+func (s Settings) ExtendedConnectEnabled() bool {
+	return s[SettingEnableConnectProtocol] == 1
+}
+
+// SetQPACKBlockedStreams sets the QPACK_BLOCKED_STREAMS value this side
+// advertises. This package's decoder has no dynamic table and never blocks a
+// stream: a field section that references one is rejected instead.
+func (s Settings) SetQPACKBlockedStreams(n uint64) {
+	s[SettingQPACKBlockedStreams] = n
+}
+
+// QPACKBlockedStreams returns the advertised QPACK blocked streams limit, or
+// 0 if none was set.
+func (s Settings) QPACKBlockedStreams() uint64 {
+	return s[SettingQPACKBlockedStreams]
+}
+
 func (s Settings) FrameType() uint64 {
 	return FrameTypeSettings
 }
@@ -113,4 +278,4 @@ func ReadSettingsFrame(r io.Reader, l uint64) (Settings, error) {
 		s[Setting(id)] = val
 	}
 	return s, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,16 @@
+package http3
+
+import "testing"
+
+func TestSettingStringRegistered(t *testing.T) {
+	if got, want := SettingDatagram.String(), "H3_DATAGRAM"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestSettingStringUnregistered(t *testing.T) {
+	const unregistered Setting = 0xdead
+	if got, want := unregistered.String(), "H3 SETTING 0xdead"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
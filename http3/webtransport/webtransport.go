@@ -0,0 +1,334 @@
+// Package webtransport implements the WebTransport session layer on top of
+// HTTP/3, as defined in draft-ietf-webtrans-http3.
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/marten-seemann/qpack"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+const (
+	// streamTypeWebTransport is the stream type prefix of a WebTransport
+	// unidirectional stream, followed by the session ID.
+	streamTypeWebTransport = http3.StreamType(0x54)
+	// frameTypeWebTransportStream is the frame type that precedes the
+	// session ID on a WebTransport bidirectional stream.
+	frameTypeWebTransportStream = 0x41
+
+	// bufferedStreamLimit is the number of streams buffered per
+	// not-yet-registered session before further streams are rejected.
+	bufferedStreamLimit = 16
+)
+
+// EnableWebTransport advertises SETTINGS_ENABLE_WEBTRANSPORT and
+// SETTINGS_H3_DATAGRAM, both of which are required for WebTransport.
+func EnableWebTransport(s http3.Settings) {
+	s[http3.SettingEnableWebTransport] = 1
+	s.EnableDatagrams()
+}
+
+func peerSupportsWebTransport(s http3.Settings) bool {
+	return s[http3.SettingEnableWebTransport] == 1 && s.DatagramsEnabled()
+}
+
+// Session is a WebTransport session, established via an HTTP/3 extended
+// CONNECT request whose stream ID also serves as the session ID.
+type Session struct {
+	id   quic.StreamID
+	str  http3.RequestStream
+	conn http3.Conn
+
+	mutex        sync.Mutex
+	acceptUni    chan quic.ReceiveStream
+	acceptBidi   chan quic.Stream
+	bufferedUni  []quic.ReceiveStream
+	bufferedBidi []quic.Stream
+}
+
+func newSession(id quic.StreamID, str http3.RequestStream, conn http3.Conn) *Session {
+	return &Session{
+		id:         id,
+		str:        str,
+		conn:       conn,
+		acceptUni:  make(chan quic.ReceiveStream, bufferedStreamLimit),
+		acceptBidi: make(chan quic.Stream, bufferedStreamLimit),
+	}
+}
+
+// SessionID returns the ID of this session, the stream ID of the CONNECT
+// request stream that established it.
+func (s *Session) SessionID() quic.StreamID { return s.id }
+
+// AcceptStream returns the next incoming bidirectional stream for this session.
+func (s *Session) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	select {
+	case str := <-s.acceptBidi:
+		return str, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// AcceptUniStream returns the next incoming unidirectional stream for this session.
+func (s *Session) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
+	select {
+	case str := <-s.acceptUni:
+		return str, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SendDatagram sends an HTTP/3 datagram scoped to this session.
+func (s *Session) SendDatagram(b []byte) error { return s.str.SendDatagram(b) }
+
+// ReceiveDatagram blocks until a datagram scoped to this session is received.
+func (s *Session) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	return s.str.ReceiveDatagram(ctx)
+}
+
+func (s *Session) enqueueUniStream(str quic.ReceiveStream) {
+	select {
+	case s.acceptUni <- str:
+	default:
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeWebTransportBufferedStreamRejected))
+	}
+}
+
+func (s *Session) enqueueStream(str quic.Stream) {
+	select {
+	case s.acceptBidi <- str:
+	default:
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeWebTransportBufferedStreamRejected))
+	}
+}
+
+var errBufferFull = errors.New("webtransport: buffered stream limit reached")
+
+func (s *Session) bufferUniStream(str quic.ReceiveStream) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.bufferedUni) >= bufferedStreamLimit {
+		return errBufferFull
+	}
+	s.bufferedUni = append(s.bufferedUni, str)
+	return nil
+}
+
+func (s *Session) bufferStream(str quic.Stream) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.bufferedBidi) >= bufferedStreamLimit {
+		return errBufferFull
+	}
+	s.bufferedBidi = append(s.bufferedBidi, str)
+	return nil
+}
+
+func (s *Session) flushBuffered() {
+	s.mutex.Lock()
+	uni, bidi := s.bufferedUni, s.bufferedBidi
+	s.bufferedUni, s.bufferedBidi = nil, nil
+	s.mutex.Unlock()
+	for _, str := range uni {
+		s.enqueueUniStream(str)
+	}
+	for _, str := range bidi {
+		s.enqueueStream(str)
+	}
+}
+
+var connectHeaders = func(authority, path string) []qpack.HeaderField {
+	return []qpack.HeaderField{
+		{Name: ":method", Value: "CONNECT"},
+		{Name: ":protocol", Value: "webtransport"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: authority},
+		{Name: ":path", Value: path},
+	}
+}
+
+func isSuccessStatus(headers []qpack.HeaderField) bool {
+	for _, h := range headers {
+		if h.Name == ":status" {
+			return len(h.Value) == 3 && h.Value[0] == '2'
+		}
+	}
+	return false
+}
+
+func headerValue(headers []qpack.HeaderField, name string) (string, bool) {
+	for _, h := range headers {
+		if h.Name == name {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+func readSessionID(r quic.ReceiveStream) (quic.StreamID, error) {
+	id, err := quicvarint.Read(quicvarint.NewReader(r))
+	if err != nil {
+		return 0, err
+	}
+	return quic.StreamID(id), nil
+}
+
+func isExtendedConnect(headers []qpack.HeaderField) bool {
+	method, _ := headerValue(headers, ":method")
+	proto, _ := headerValue(headers, ":protocol")
+	return method == "CONNECT" && proto == "webtransport"
+}
+
+// Server accepts WebTransport sessions negotiated over extended-CONNECT
+// requests on an HTTP/3 server connection.
+type Server struct {
+	conn http3.ServerConn
+
+	mutex    sync.Mutex
+	sessions map[quic.StreamID]*Session
+}
+
+// NewServer registers the unidirectional stream handler that demultiplexes
+// WebTransport uni streams onto their sessions. It registers nothing for
+// bidirectional streams: those reach a session only when the caller passes
+// them to HandleBidiStream. conn's settings must
+// have been configured with EnableWebTransport before the connection sent
+// its SETTINGS frame.
+func NewServer(conn http3.ServerConn) (*Server, error) {
+	s := &Server{conn: conn, sessions: make(map[quic.StreamID]*Session)}
+	if err := conn.RegisterUniStreamHandler(streamTypeWebTransport, s.handleUniStream); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// handleUniStream reads the session ID that follows the WebTransport stream
+// type prefix and routes str to the matching session, buffering it if the
+// session's CONNECT request hasn't been accepted yet. The accepted check and
+// the buffer-or-enqueue decision happen under s.mutex, the same lock Accept
+// holds while registering a session and flushing its buffer, so a stream
+// can't be buffered after the only flush that will ever run.
+func (s *Server) handleUniStream(str quic.ReceiveStream) {
+	id, err := readSessionID(str)
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeWebTransportBufferedStreamRejected))
+		return
+	}
+	s.mutex.Lock()
+	sess := s.pendingLocked(id)
+	if sess.str != nil {
+		s.mutex.Unlock()
+		sess.enqueueUniStream(str)
+		return
+	}
+	err = sess.bufferUniStream(str)
+	s.mutex.Unlock()
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeWebTransportBufferedStreamRejected))
+	}
+}
+
+// HandleBidiStream routes str to the session it belongs to, if frameType is
+// the WEBTRANSPORT_STREAM frame type. The HTTP/3 request-dispatch loop is
+// expected to have already read the leading frame type off str, since it
+// needs to do so anyway to tell a HEADERS-initiated request apart from other
+// uses of a bidirectional stream. It returns false if frameType doesn't
+// indicate a WebTransport stream, in which case the caller should continue
+// handling str as a normal request. See handleUniStream for why the
+// accepted check and the buffer-or-enqueue decision happen under s.mutex.
+func (s *Server) HandleBidiStream(str quic.Stream, frameType uint64) (bool, error) {
+	if frameType != frameTypeWebTransportStream {
+		return false, nil
+	}
+	id, err := readSessionID(str)
+	if err != nil {
+		return true, err
+	}
+	s.mutex.Lock()
+	sess := s.pendingLocked(id)
+	if sess.str != nil {
+		s.mutex.Unlock()
+		sess.enqueueStream(str)
+		return true, nil
+	}
+	err = sess.bufferStream(str)
+	s.mutex.Unlock()
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeWebTransportBufferedStreamRejected))
+	}
+	return true, nil
+}
+
+// pendingLocked returns the (possibly not-yet-CONNECTed) session for id,
+// creating a placeholder to buffer streams into if necessary. s.mutex must
+// be held.
+func (s *Server) pendingLocked(id quic.StreamID) *Session {
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = newSession(id, nil, s.conn)
+		s.sessions[id] = sess
+	}
+	return sess
+}
+
+// Accept validates str as an extended CONNECT request for WebTransport,
+// responds with a 200, and returns the established Session.
+func (s *Server) Accept(str http3.RequestStream) (*Session, error) {
+	headers, err := str.ReadHeaders()
+	if err != nil {
+		return nil, err
+	}
+	if !isExtendedConnect(headers) {
+		return nil, errors.New("webtransport: not an extended CONNECT request")
+	}
+	if err := str.SendHeaders([]qpack.HeaderField{{Name: ":status", Value: "200"}}); err != nil {
+		return nil, err
+	}
+
+	id := str.StreamID()
+	s.mutex.Lock()
+	sess := s.pendingLocked(id)
+	sess.str = str
+	sess.flushBuffered()
+	s.mutex.Unlock()
+
+	return sess, nil
+}
+
+// Dial establishes a new WebTransport session on conn by sending an extended
+// CONNECT request for the given authority and path.
+func Dial(ctx context.Context, conn http3.ClientConn, authority, path string) (*Session, error) {
+	peerSettings, err := conn.PeerSettings()
+	if err != nil {
+		return nil, err
+	}
+	if !peerSupportsWebTransport(peerSettings) {
+		return nil, errors.New("webtransport: peer did not advertise support")
+	}
+
+	str, err := conn.OpenRequestStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := str.SendHeaders(connectHeaders(authority, path)); err != nil {
+		return nil, err
+	}
+	respHeaders, err := str.ReadHeaders()
+	if err != nil {
+		return nil, err
+	}
+	if !isSuccessStatus(respHeaders) {
+		status, _ := headerValue(respHeaders, ":status")
+		return nil, fmt.Errorf("webtransport: CONNECT rejected with status %s", status)
+	}
+	return newSession(str.StreamID(), str, conn), nil
+}